@@ -0,0 +1,79 @@
+package readylive
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// Stats reports the connection counters maintained by a Server's listener.
+type Stats struct {
+	// ActiveConns is the number of connections currently being served.
+	ActiveConns int64
+	// TotalAccepted is the number of connections accepted since the server
+	// started serving.
+	TotalAccepted int64
+	// Rejected is the number of connections refused because
+	// WithMaxConcurrentConnections was exceeded.
+	Rejected int64
+}
+
+// trackingListener wraps a net.Listener, counting in-flight connections and,
+// if max is greater than zero, refusing accepts once that many connections
+// are active.
+type trackingListener struct {
+	net.Listener
+	max int
+
+	active   int64
+	accepted int64
+	rejected int64
+}
+
+func newTrackingListener(l net.Listener, max int) *trackingListener {
+	return &trackingListener{Listener: l, max: max}
+}
+
+func (l *trackingListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		if l.max > 0 && atomic.LoadInt64(&l.active) >= int64(l.max) {
+			atomic.AddInt64(&l.rejected, 1)
+			conn.Close()
+			continue
+		}
+
+		atomic.AddInt64(&l.accepted, 1)
+		atomic.AddInt64(&l.active, 1)
+		return &trackedConn{Conn: conn, l: l}, nil
+	}
+}
+
+func (l *trackingListener) Stats() Stats {
+	return Stats{
+		ActiveConns:   atomic.LoadInt64(&l.active),
+		TotalAccepted: atomic.LoadInt64(&l.accepted),
+		Rejected:      atomic.LoadInt64(&l.rejected),
+	}
+}
+
+// trackedConn decrements its listener's active count exactly once, on the
+// first Close call.
+type trackedConn struct {
+	net.Conn
+	l *trackingListener
+
+	closeOnce sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		atomic.AddInt64(&c.l.active, -1)
+	})
+	return err
+}
@@ -0,0 +1,63 @@
+package readylive
+
+import (
+	"io"
+	"net"
+	"testing"
+)
+
+type fakeConn struct {
+	net.Conn
+	closed bool
+}
+
+func (c *fakeConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+type fakeListener struct {
+	conns []net.Conn
+}
+
+func (l *fakeListener) Accept() (net.Conn, error) {
+	if len(l.conns) == 0 {
+		return nil, io.EOF
+	}
+	c := l.conns[0]
+	l.conns = l.conns[1:]
+	return c, nil
+}
+
+func (l *fakeListener) Close() error   { return nil }
+func (l *fakeListener) Addr() net.Addr { return nil }
+
+func TestTrackingListenerRejectsOverMax(t *testing.T) {
+	first, second, third := &fakeConn{}, &fakeConn{}, &fakeConn{}
+	l := newTrackingListener(&fakeListener{conns: []net.Conn{first, second, third}}, 2)
+
+	c1, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Accept(); err != nil {
+		t.Fatal(err)
+	}
+	// The third connection exceeds the limit and is rejected; the listener
+	// then has nothing left to accept.
+	if _, err := l.Accept(); err != io.EOF {
+		t.Fatalf("want io.EOF, got %v", err)
+	}
+
+	if !third.closed {
+		t.Error("want the connection over the limit to be closed")
+	}
+	if stats := l.Stats(); stats.ActiveConns != 2 || stats.Rejected != 1 {
+		t.Errorf("want 2 active and 1 rejected, got %+v", stats)
+	}
+
+	c1.Close()
+	if active := l.Stats().ActiveConns; active != 1 {
+		t.Errorf("want 1 active connection after close, got %d", active)
+	}
+}
@@ -0,0 +1,258 @@
+package readylive
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Probe is a named health check that can be registered with a Server to
+// contribute to the outcome of its readiness or liveness endpoint. Typical
+// probes ping a database, call a dependent HTTP service, or check available
+// disk space.
+type Probe interface {
+	// Check reports whether the probe is healthy. A non-nil error marks the
+	// probe, and therefore the endpoint it is registered under, as failing.
+	Check(ctx context.Context) error
+}
+
+// ProbeFunc adapts an ordinary function to a Probe.
+type ProbeFunc func(ctx context.Context) error
+
+// Check calls f(ctx).
+func (f ProbeFunc) Check(ctx context.Context) error { return f(ctx) }
+
+// probeResult is the outcome of running a single probe, as reported in the
+// JSON response body of the default readiness and liveness handlers.
+type probeResult struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Latency string `json:"latency"`
+	Error   string `json:"error,omitempty"`
+}
+
+// probeReport is the Kubernetes-style JSON body returned by the default
+// readiness and liveness handlers.
+type probeReport struct {
+	Status string        `json:"status"`
+	Checks []probeResult `json:"checks,omitempty"`
+}
+
+type cachedProbeResult struct {
+	result probeResult
+	ok     bool
+	at     time.Time
+}
+
+// probeHandler is the default readiness/liveness http.Handler. It combines a
+// manually controlled boolean flag (see SetReady/Ready) with a registry of
+// named probes that are run, in parallel, on every request.
+type probeHandler struct {
+	mu    sync.Mutex
+	ready bool
+
+	probesMu sync.Mutex
+	names    []string
+	probes   map[string]Probe
+
+	timeout     time.Duration
+	cacheTTL    time.Duration
+	concurrency int
+
+	cacheMu sync.Mutex
+	cache   map[string]cachedProbeResult
+}
+
+// newProbeHandler creates a probeHandler. If shutdownCtx is non-nil, the
+// handler flips itself unready once shutdownCtx is done, so it does not
+// depend on SetReady being called explicitly.
+func newProbeHandler(ready bool, timeout, cacheTTL time.Duration, concurrency int, shutdownCtx context.Context) *probeHandler {
+	h := &probeHandler{
+		ready:       ready,
+		probes:      make(map[string]Probe),
+		timeout:     timeout,
+		cacheTTL:    cacheTTL,
+		concurrency: concurrency,
+		cache:       make(map[string]cachedProbeResult),
+	}
+
+	if shutdownCtx != nil {
+		go func() {
+			<-shutdownCtx.Done()
+			h.SetReady(false)
+		}()
+	}
+
+	return h
+}
+
+// SetReady sets the manual part of the handler's health flag. Probes are
+// only evaluated while it is true; once it is false the handler reports
+// unhealthy immediately, without running any probe.
+func (h *probeHandler) SetReady(ready bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ready = ready
+}
+
+// Ready reports the manual part of the handler's health flag.
+func (h *probeHandler) Ready() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.ready
+}
+
+// Register adds a named probe to the registry. Registering a probe under a
+// name that is already taken replaces it.
+func (h *probeHandler) Register(name string, p Probe) {
+	h.probesMu.Lock()
+	defer h.probesMu.Unlock()
+
+	if _, ok := h.probes[name]; !ok {
+		h.names = append(h.names, name)
+	}
+	h.probes[name] = p
+}
+
+// run executes every registered probe, honoring the configured timeout,
+// cache TTL and concurrency limit, and reports whether all of them are
+// healthy. It does not look at the manual flag; ServeHTTP checks that.
+func (h *probeHandler) run(ctx context.Context) (bool, []probeResult) {
+	h.probesMu.Lock()
+	names := append([]string(nil), h.names...)
+	probes := make(map[string]Probe, len(h.probes))
+	for name, p := range h.probes {
+		probes[name] = p
+	}
+	h.probesMu.Unlock()
+
+	results := make([]probeResult, len(names))
+	oks := make([]bool, len(names))
+
+	var sem chan struct{}
+	if h.concurrency > 0 {
+		sem = make(chan struct{}, h.concurrency)
+	}
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		if cached, ok := h.cached(name); ok {
+			results[i] = cached.result
+			oks[i] = cached.ok
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, name string, p Probe) {
+			defer wg.Done()
+			if sem != nil {
+				sem <- struct{}{}
+				defer func() { <-sem }()
+			}
+
+			res, ok := h.checkOne(ctx, name, p)
+			results[i] = res
+			oks[i] = ok
+			h.storeCache(name, res, ok)
+		}(i, name, probes[name])
+	}
+	wg.Wait()
+
+	allOK := true
+	for _, ok := range oks {
+		if !ok {
+			allOK = false
+			break
+		}
+	}
+	return allOK, results
+}
+
+func (h *probeHandler) cached(name string) (cachedProbeResult, bool) {
+	if h.cacheTTL <= 0 {
+		return cachedProbeResult{}, false
+	}
+
+	h.cacheMu.Lock()
+	defer h.cacheMu.Unlock()
+
+	c, ok := h.cache[name]
+	if !ok || time.Since(c.at) > h.cacheTTL {
+		return cachedProbeResult{}, false
+	}
+	return c, true
+}
+
+func (h *probeHandler) storeCache(name string, res probeResult, ok bool) {
+	if h.cacheTTL <= 0 {
+		return
+	}
+
+	h.cacheMu.Lock()
+	defer h.cacheMu.Unlock()
+	h.cache[name] = cachedProbeResult{result: res, ok: ok, at: time.Now()}
+}
+
+func (h *probeHandler) checkOne(ctx context.Context, name string, p Probe) (probeResult, bool) {
+	cctx := ctx
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		cctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := p.Check(cctx)
+	if err == nil && h.timeout > 0 && cctx.Err() == context.DeadlineExceeded {
+		err = cctx.Err()
+	}
+	res := probeResult{
+		Name:    name,
+		Status:  "ok",
+		Latency: time.Since(start).String(),
+	}
+	if err != nil {
+		res.Status = "error"
+		res.Error = err.Error()
+	}
+	return res, err == nil
+}
+
+func (h *probeHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ok := h.Ready()
+
+	var checks []probeResult
+	if ok {
+		ok, checks = h.run(req.Context())
+	}
+
+	status := http.StatusOK
+	statusText := "ok"
+	if !ok {
+		status = http.StatusServiceUnavailable
+		statusText = "error"
+	}
+
+	if acceptsPlainText(req) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		if ok {
+			w.Write([]byte("OK"))
+		} else {
+			w.Write([]byte("UNAVAILABLE"))
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(probeReport{Status: statusText, Checks: checks})
+}
+
+func acceptsPlainText(req *http.Request) bool {
+	accept := req.Header.Get("Accept")
+	return accept != "" && strings.Contains(accept, "text/plain") && !strings.Contains(accept, "application/json")
+}
@@ -0,0 +1,59 @@
+package readylive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProbeHandlerAggregatesFailures(t *testing.T) {
+	h := newProbeHandler(true, 0, 0, 0, nil)
+	h.Register("ok", ProbeFunc(func(ctx context.Context) error { return nil }))
+	h.Register("bad", ProbeFunc(func(ctx context.Context) error { return errors.New("boom") }))
+
+	req := httptest.NewRequest(http.MethodGet, "/ready", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("want status %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+
+	var report probeReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if report.Status != "error" {
+		t.Errorf("want status %q, got %q", "error", report.Status)
+	}
+	if len(report.Checks) != 2 {
+		t.Fatalf("want 2 checks, got %d", len(report.Checks))
+	}
+}
+
+func TestProbeHandlerNotReadySkipsProbes(t *testing.T) {
+	ran := false
+	h := newProbeHandler(false, 0, 0, 0, nil)
+	h.Register("ok", ProbeFunc(func(ctx context.Context) error {
+		ran = true
+		return nil
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/ready", nil)
+	req.Header.Set("Accept", "text/plain")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("want status %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if ran {
+		t.Error("probe should not run while the handler is not ready")
+	}
+	if rec.Body.String() != "UNAVAILABLE" {
+		t.Errorf("want plain text body %q, got %q", "UNAVAILABLE", rec.Body.String())
+	}
+}
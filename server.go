@@ -6,35 +6,16 @@ package readylive
 
 import (
 	"context"
+	"crypto/tls"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 )
 
-type readinessHandler struct {
-	mu    sync.Mutex
-	ready bool
-}
-
-func (h *readinessHandler) SetReady(ready bool) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	h.ready = ready
-}
-
-func (h *readinessHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	if h.ready {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	w.WriteHeader(http.StatusServiceUnavailable)
-}
-
 // ServerOption configures a server instance.
 type ServerOption func(s *Server)
 
@@ -83,6 +64,82 @@ func ShutdownTimeout(d time.Duration) ServerOption {
 	}
 }
 
+// WithProbeTimeout sets the maximum duration a single probe's Check is
+// allowed to run before it is considered failed. The default is one second.
+func WithProbeTimeout(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.probeTimeout = d
+	}
+}
+
+// WithProbeCacheTTL sets how long a probe's last result is reused before the
+// probe is run again, throttling expensive checks between scrapes. The
+// default, zero, disables caching and runs every probe on every request.
+func WithProbeCacheTTL(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.probeCacheTTL = d
+	}
+}
+
+// WithProbeConcurrency limits how many probes are run concurrently while
+// serving a single request. The default, zero, runs all registered probes
+// for that endpoint in parallel.
+func WithProbeConcurrency(n int) ServerOption {
+	return func(s *Server) {
+		s.probeConcurrency = n
+	}
+}
+
+// WithMaxConcurrentConnections limits how many connections the server
+// accepts at once. Connections beyond the limit are refused (and counted in
+// Stats().Rejected) until an existing connection is closed. The default,
+// zero, does not limit concurrent connections.
+func WithMaxConcurrentConnections(n int) ServerOption {
+	return func(s *Server) {
+		s.maxConns = n
+	}
+}
+
+// WithBeforeShutdown registers a hook that runs before Shutdown flips
+// readiness to false. Returning an error aborts the shutdown sequence; the
+// error is returned from Shutdown (and therefore from Run) without closing
+// the underlying server.
+func WithBeforeShutdown(fn func(context.Context) error) ServerOption {
+	return func(s *Server) {
+		s.beforeShutdown = fn
+	}
+}
+
+// WithAfterShutdown registers a hook that runs once the server has stopped,
+// whether it drained gracefully or was forced closed after shutdownTimeout.
+// Use it to flush queues, close database pools, or deregister from service
+// discovery.
+func WithAfterShutdown(fn func(context.Context) error) ServerOption {
+	return func(s *Server) {
+		s.afterShutdown = fn
+	}
+}
+
+// WithShutdownContext makes the server drive its shutdown signal through
+// ctx and cancel instead of the pair it would otherwise create for itself.
+// A custom readiness or liveness handler can accept ctx in its own
+// constructor and watch ctx.Done() to react to shutdown, instead of
+// implementing ReadinessController. See NewShutdownContext.
+func WithShutdownContext(ctx context.Context, cancel context.CancelFunc) ServerOption {
+	return func(s *Server) {
+		s.shutdownCtx = ctx
+		s.shutdownCancel = cancel
+	}
+}
+
+// NewShutdownContext creates a context/cancel pair suitable for
+// WithShutdownContext. Create it before constructing a custom handler that
+// needs to observe the server's shutdown signal, then pass the context to
+// the handler's constructor and the pair to WithShutdownContext.
+func NewShutdownContext() (context.Context, context.CancelFunc) {
+	return context.WithCancel(context.Background())
+}
+
 // Server is a HTTP server with additional readiness and liveness check
 // endpoints.
 type Server struct {
@@ -100,6 +157,50 @@ type Server struct {
 
 	// errChan gets errors returned by srv.ListenAndServe.
 	errChan chan error
+
+	// readinessProbes and livenessProbes back the default ready and alive
+	// handlers. They are unused once WithReadyHandler or WithAliveHandler
+	// replaces the corresponding handler.
+	readinessProbes *probeHandler
+	livenessProbes  *probeHandler
+
+	probeTimeout     time.Duration
+	probeCacheTTL    time.Duration
+	probeConcurrency int
+
+	// beforeShutdown and afterShutdown, if set, run at the start and end of
+	// Shutdown respectively.
+	beforeShutdown func(context.Context) error
+	afterShutdown  func(context.Context) error
+
+	// tlsConfig is used by ListenAndServeTLS and ServeTLS when s.srv.TLSConfig
+	// is not already set.
+	tlsConfig *tls.Config
+
+	setupOnce sync.Once
+
+	// maxConns is the maximum number of concurrent connections the listener
+	// accepts. Zero means unlimited.
+	maxConns int
+
+	listenerMu sync.Mutex
+	listener   *trackingListener
+
+	// shutdownCtx is canceled, and shutdownCancel called, when Shutdown
+	// begins. It defaults to a context the Server creates for itself, but
+	// can be supplied via WithShutdownContext.
+	shutdownCtx    context.Context
+	shutdownCancel context.CancelFunc
+}
+
+// ReadinessController lets callers observe and control a health handler's
+// ready state directly. The default readiness and liveness handlers
+// implement it; Server.Readiness and Server.Liveness return it for the
+// handlers currently in use, or nil for a custom handler that does not
+// implement it.
+type ReadinessController interface {
+	SetReady(ready bool)
+	Ready() bool
 }
 
 // WrapServer attaches readiness and liveness handlers to srv.
@@ -118,72 +219,210 @@ func WrapServer(srv *http.Server, options ...ServerOption) *Server {
 		shutdownWait:    15 * time.Second,
 		shutdownTimeout: 5 * time.Second,
 		errChan:         make(chan error, 1),
+		probeTimeout:    time.Second,
 	}
 
 	for _, opt := range options {
 		opt(s)
 	}
 
-	return s
-}
+	if s.shutdownCtx == nil {
+		s.shutdownCtx, s.shutdownCancel = NewShutdownContext()
+	}
 
-// ListenAndServe starts the server in its own goroutine.
-func (s *Server) ListenAndServe() {
-	// Attach ready and alive handlers.
+	// The liveness handler deliberately does not subscribe to shutdownCtx:
+	// a server draining connections is still alive, and should not be
+	// restarted by an orchestrator's liveness check.
+	s.readinessProbes = newProbeHandler(true, s.probeTimeout, s.probeCacheTTL, s.probeConcurrency, s.shutdownCtx)
+	s.livenessProbes = newProbeHandler(true, s.probeTimeout, s.probeCacheTTL, s.probeConcurrency, nil)
+
+	// Default the handlers and paths here, while WrapServer's caller still
+	// owns s exclusively. ListenAndServe and friends may run prepare (and
+	// therefore these fields must be finalized) from a different goroutine
+	// than the one that calls Readiness, Liveness or SetReady.
 	if s.ready == nil {
-		s.ready = &readinessHandler{ready: true}
+		s.ready = s.readinessProbes
 	}
 	if s.readyPath == "" {
 		s.readyPath = "/ready"
 	}
 	if s.alive == nil {
-		s.alive = &readinessHandler{ready: true}
+		s.alive = s.livenessProbes
 	}
 	if s.alivePath == "" {
 		s.alivePath = "/health"
 	}
 
-	mux := http.NewServeMux()
-	mux.Handle(s.readyPath, s.ready)
-	mux.Handle(s.alivePath, s.alive)
-	mux.Handle("/", s.srv.Handler)
-	s.srv.Handler = mux
+	return s
+}
+
+// Readiness returns the ReadinessController for the handler currently
+// serving the readiness endpoint. It returns nil if the handler was set via
+// WithReadyHandler and does not implement ReadinessController.
+func (s *Server) Readiness() ReadinessController {
+	rc, _ := s.ready.(ReadinessController)
+	return rc
+}
+
+// Liveness returns the ReadinessController for the handler currently
+// serving the liveness endpoint. It returns nil if the handler was set via
+// WithAliveHandler and does not implement ReadinessController.
+func (s *Server) Liveness() ReadinessController {
+	rc, _ := s.alive.(ReadinessController)
+	return rc
+}
+
+// SetReady sets the manual readiness flag on the server's readiness
+// handler, for example to flip it unready ahead of a dependency flap or a
+// rolling deploy. It has no effect if the readiness handler does not
+// implement ReadinessController.
+func (s *Server) SetReady(ready bool) {
+	if rc := s.Readiness(); rc != nil {
+		rc.SetReady(ready)
+	}
+}
+
+// RegisterReadinessProbe adds a named probe that the default /ready handler
+// runs on every request. It has no effect if the server was configured with
+// WithReadyHandler.
+func (s *Server) RegisterReadinessProbe(name string, p Probe) {
+	s.readinessProbes.Register(name, p)
+}
+
+// RegisterLivenessProbe adds a named probe that the default /health handler
+// runs on every request. It has no effect if the server was configured with
+// WithAliveHandler.
+func (s *Server) RegisterLivenessProbe(name string, p Probe) {
+	s.livenessProbes.Register(name, p)
+}
 
-	go func() {
-		s.errChan <- s.srv.ListenAndServe()
-	}()
+// prepare builds the mux that dispatches to the ready and alive handlers
+// (both finalized by WrapServer) and installs it as s.srv.Handler. It runs
+// at most once, so it is safe to call from any of the Listen/Serve variants.
+func (s *Server) prepare() {
+	s.setupOnce.Do(func() {
+		mux := http.NewServeMux()
+		mux.Handle(s.readyPath, s.ready)
+		mux.Handle(s.alivePath, s.alive)
+		mux.Handle("/", s.srv.Handler)
+		s.srv.Handler = mux
+	})
+}
+
+// listen creates the listener ListenAndServe serves on, mirroring the addr
+// defaulting http.Server.ListenAndServe applies internally.
+func (s *Server) listen() (net.Listener, error) {
+	addr := s.srv.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+	return net.Listen("tcp", addr)
+}
+
+// ListenAndServe starts the server. It blocks until the server stops, and
+// returns the same error http.Server.ListenAndServe would.
+func (s *Server) ListenAndServe() error {
+	l, err := s.listen()
+	if err != nil {
+		s.errChan <- err
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Stats reports connection counters for the server's listener. It returns
+// the zero value until the server starts serving via ListenAndServe, Serve,
+// ListenAndServeTLS or ServeTLS.
+func (s *Server) Stats() Stats {
+	s.listenerMu.Lock()
+	l := s.listener
+	s.listenerMu.Unlock()
+
+	if l == nil {
+		return Stats{}
+	}
+	return l.Stats()
 }
 
 // Shutdown shutdowns the server gracefully.
 // It returns any error returned by the underlying http.Server.
 func (s *Server) Shutdown(ctx context.Context) error {
-	// TODO(ivan): Document this specific behavior.
-	if r, ok := s.ready.(readiness); ok {
-		r.SetReady(false)
+	if s.beforeShutdown != nil {
+		if err := s.beforeShutdown(ctx); err != nil {
+			return err
+		}
 	}
 
-	wait := time.After(s.shutdownWait)
-	select {
-	case err := <-s.errChan:
-		// The server did not start.
-		return err
-	case <-wait:
-		break
-	case <-ctx.Done():
-		break
+	if rc := s.Readiness(); rc != nil {
+		rc.SetReady(false)
 	}
+	s.shutdownCancel()
+
+	var err error
+	deadline := time.After(s.shutdownWait)
+	drained := time.NewTicker(50 * time.Millisecond)
+	defer drained.Stop()
 
-	ctx, cancel := context.WithTimeout(ctx, s.shutdownTimeout)
-	defer cancel()
-	if err := s.srv.Shutdown(ctx); err != nil {
-		if err == context.DeadlineExceeded {
-			return s.srv.Close()
+wait:
+	for {
+		select {
+		case err = <-s.errChan:
+			// The server did not start.
+			break wait
+		case <-deadline:
+			break wait
+		case <-ctx.Done():
+			break wait
+		case <-drained.C:
+			if s.Stats().ActiveConns == 0 {
+				break wait
+			}
+		}
+	}
+
+	if err == nil {
+		sctx, cancel := context.WithTimeout(ctx, s.shutdownTimeout)
+		defer cancel()
+		if serr := s.srv.Shutdown(sctx); serr != nil {
+			if serr == context.DeadlineExceeded {
+				err = s.srv.Close()
+			} else {
+				err = serr
+			}
 		}
-		return err
 	}
-	return nil
+
+	if s.afterShutdown != nil {
+		if aerr := s.afterShutdown(ctx); err == nil {
+			err = aerr
+		}
+	}
+
+	return err
 }
 
-type readiness interface {
-	SetReady(bool)
+// Run starts the server and blocks until ctx is canceled or one of signals
+// is received (os.Interrupt and syscall.SIGTERM if none are given), then
+// shuts it down gracefully by calling Shutdown. It is equivalent to calling
+// ListenAndServe, wiring up signal.Notify, and calling Shutdown once a
+// signal or ctx.Done fires.
+func (s *Server) Run(ctx context.Context, signals ...os.Signal) error {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	go s.ListenAndServe()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, signals...)
+	defer signal.Stop(sigCh)
+
+	select {
+	case <-ctx.Done():
+	case <-sigCh:
+	case err := <-s.errChan:
+		return err
+	}
+
+	return s.Shutdown(context.WithoutCancel(ctx))
 }
@@ -3,6 +3,7 @@ package readylive_test
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"testing"
 	"time"
@@ -45,6 +46,97 @@ func TestServer(t *testing.T) {
 	}
 }
 
+func TestServerRunShutdownHooks(t *testing.T) {
+	srv := &http.Server{
+		Handler: http.NotFoundHandler(),
+		Addr:    "localhost:53219",
+	}
+
+	var before, after bool
+	wsrv := readylive.WrapServer(srv,
+		readylive.WaitBeforeShutdown(time.Millisecond),
+		readylive.WithBeforeShutdown(func(context.Context) error {
+			before = true
+			return nil
+		}),
+		readylive.WithAfterShutdown(func(context.Context) error {
+			after = true
+			return nil
+		}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := wsrv.Run(ctx); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	if !before {
+		t.Error("want before-shutdown hook to run")
+	}
+	if !after {
+		t.Error("want after-shutdown hook to run")
+	}
+}
+
+func TestServerServeInjectedListener(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &http.Server{Handler: http.NotFoundHandler()}
+	wsrv := readylive.WrapServer(srv, readylive.WaitBeforeShutdown(time.Millisecond))
+
+	go func() {
+		err := wsrv.Serve(l)
+		if err != http.ErrServerClosed {
+			t.Error(err)
+		}
+	}()
+
+	time.Sleep(time.Millisecond)
+
+	checkStatus(t, fmt.Sprintf("http://%s/ready", l.Addr()), 200)
+
+	if err := wsrv.Shutdown(context.Background()); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+}
+
+func TestServerSetReady(t *testing.T) {
+	srv := &http.Server{
+		Handler: http.NotFoundHandler(),
+		Addr:    "localhost:53220",
+	}
+
+	wsrv := readylive.WrapServer(srv)
+
+	go func() {
+		err := wsrv.ListenAndServe()
+		if err != http.ErrServerClosed {
+			t.Error(err)
+		}
+	}()
+
+	time.Sleep(time.Millisecond)
+
+	checkStatus(t, fmt.Sprintf("http://%s/ready", srv.Addr), 200)
+
+	wsrv.SetReady(false)
+	checkStatus(t, fmt.Sprintf("http://%s/ready", srv.Addr), 503)
+
+	if wsrv.Readiness() == nil {
+		t.Fatal("want a non-nil ReadinessController for the default readiness handler")
+	}
+	if wsrv.Readiness().Ready() {
+		t.Error("want Ready() to report false after SetReady(false)")
+	}
+
+	if err := wsrv.Shutdown(context.Background()); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+}
+
 func checkStatus(t *testing.T, url string, status int) {
 	resp, err := http.Get(url)
 	if err != nil {
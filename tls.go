@@ -0,0 +1,80 @@
+package readylive
+
+import (
+	"crypto/tls"
+	"net"
+
+	"golang.org/x/net/http2"
+)
+
+// WithTLSConfig sets the TLS configuration used by ListenAndServeTLS and
+// ServeTLS. It is ignored if the wrapped http.Server already has a
+// TLSConfig set directly.
+func WithTLSConfig(cfg *tls.Config) ServerOption {
+	return func(s *Server) {
+		s.tlsConfig = cfg
+	}
+}
+
+// Serve works like ListenAndServe, but accepts connections on l instead of
+// creating its own listener. It blocks until the server stops.
+func (s *Server) Serve(l net.Listener) error {
+	s.prepare()
+	l = s.wrapListener(l)
+
+	err := s.srv.Serve(l)
+	s.errChan <- err
+	return err
+}
+
+// ListenAndServeTLS works like ListenAndServe, but expects HTTPS connections.
+// Additionally, files containing a certificate and matching private key for
+// the server must be provided. It configures the underlying server for
+// HTTP/2, the same way http.Server.ListenAndServeTLS does.
+func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	addr := s.srv.Addr
+	if addr == "" {
+		addr = ":https"
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		s.errChan <- err
+		return err
+	}
+	return s.ServeTLS(l, certFile, keyFile)
+}
+
+// ServeTLS works like ListenAndServeTLS, but accepts connections on l
+// instead of creating its own listener. This allows callers to terminate
+// TLS themselves, e.g. for certificate rotation or mutual TLS, while still
+// getting the readiness-flip-before-shutdown behavior of Shutdown.
+func (s *Server) ServeTLS(l net.Listener, certFile, keyFile string) error {
+	s.prepare()
+	s.configureTLS()
+	l = s.wrapListener(l)
+
+	err := s.srv.ServeTLS(l, certFile, keyFile)
+	s.errChan <- err
+	return err
+}
+
+// wrapListener wraps l with connection limiting and drain tracking, and
+// remembers it so Stats and Shutdown can observe connection counts.
+func (s *Server) wrapListener(l net.Listener) net.Listener {
+	tl := newTrackingListener(l, s.maxConns)
+
+	s.listenerMu.Lock()
+	s.listener = tl
+	s.listenerMu.Unlock()
+
+	return tl
+}
+
+// configureTLS applies the configured TLS config to s.srv, if it is not
+// already set, and enables HTTP/2.
+func (s *Server) configureTLS() {
+	if s.srv.TLSConfig == nil {
+		s.srv.TLSConfig = s.tlsConfig
+	}
+	http2.ConfigureServer(s.srv, &http2.Server{})
+}